@@ -14,10 +14,13 @@
 package svg
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os/exec"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gohugoio/hugo/common/herrors"
 	"github.com/gohugoio/hugo/hugolib/filesystems"
@@ -36,6 +39,111 @@ type Options struct {
 	ElementID      string
 	ExportArea     string
 	ExportAreaSnap bool
+
+	// Backend selects the rasterization backend used to render the SVG.
+	// One of "inkscape", "native" or "auto" (the default). "auto" uses
+	// Inkscape when it's available on PATH and falls back to the native,
+	// pure-Go backend otherwise. Note that "native" is only fully
+	// hermetic for Format "png" and "jpeg"; Format "webp" still shells out
+	// to the external "cwebp" binary (see Format), and Format "pdf"/"ps"
+	// aren't supported at all by "native" (ErrFeatureNotAvailable).
+	Backend string
+
+	// Sizes, when set, produces one variant (in Format) per requested width instead
+	// of a single image. Used by Client.Process to build srcset-ready
+	// resource.Resources. Width and Height are ignored when Sizes is set.
+	Sizes []int
+
+	// Format is the output format: "png" (the default), "webp", "jpeg",
+	// "pdf" or "ps". "webp" requires the "cwebp" binary on PATH regardless
+	// of Backend -- there is no maintained pure-Go WebP encoder -- so it is
+	// not available in fully hermetic (no-external-binaries) environments.
+	Format string
+
+	// Quality is the output quality for the "jpeg" and "webp" formats,
+	// 1-100. Defaults to 85.
+	Quality int
+
+	// DPI sets the export resolution in dots per inch (Inkscape's
+	// --export-dpi).
+	DPI float64
+
+	// Background sets the export background color (Inkscape's
+	// --export-background), e.g. "#ffffff".
+	Background string
+
+	// BackgroundOpacity sets the export background opacity, 0.0-1.0
+	// (Inkscape's --export-background-opacity).
+	BackgroundOpacity float64
+
+	// PoolSize, when > 0, enables a bounded pool of long-lived
+	// `inkscape --shell` worker processes (Inkscape 1.x only) instead of
+	// spawning a fresh inkscape process per Transform call. This avoids
+	// paying Inkscape's startup cost on every resource, which matters on
+	// sites with hundreds of SVGs.
+	PoolSize int
+
+	// PoolMaxJobsPerWorker bounds how many jobs a pooled worker handles
+	// before it's recycled, to bound memory growth in long-lived Inkscape
+	// shell sessions. Defaults to 500.
+	PoolMaxJobsPerWorker int
+}
+
+const (
+	backendInkscape = "inkscape"
+	backendNative   = "native"
+	backendAuto     = "auto"
+)
+
+func (opts Options) backend() string {
+	if opts.Backend == "" {
+		return backendAuto
+	}
+	return opts.Backend
+}
+
+const defaultQuality = 85
+
+func (opts Options) format() string {
+	if opts.Format == "" {
+		return "png"
+	}
+	return opts.Format
+}
+
+func (opts Options) quality() int {
+	if opts.Quality == 0 {
+		return defaultQuality
+	}
+	return opts.Quality
+}
+
+const defaultPoolMaxJobsPerWorker = 500
+
+func (opts Options) poolMaxJobsPerWorker() int {
+	if opts.PoolMaxJobsPerWorker == 0 {
+		return defaultPoolMaxJobsPerWorker
+	}
+	return opts.PoolMaxJobsPerWorker
+}
+
+// outputMediaTypeAndExt resolves Options.Format into the resource's output
+// media type and file extension.
+func (opts Options) outputMediaTypeAndExt() (media.Type, string, error) {
+	switch opts.format() {
+	case "png":
+		return media.PNGType, "png", nil
+	case "jpeg":
+		return media.Type{MainType: "image", SubType: "jpeg", Suffixes: []string{"jpg", "jpeg"}}, "jpg", nil
+	case "webp":
+		return media.Type{MainType: "image", SubType: "webp", Suffixes: []string{"webp"}}, "webp", nil
+	case "pdf":
+		return media.Type{MainType: "application", SubType: "pdf", Suffixes: []string{"pdf"}}, "pdf", nil
+	case "ps":
+		return media.Type{MainType: "application", SubType: "postscript", Suffixes: []string{"ps"}}, "ps", nil
+	default:
+		return media.Type{}, "", fmt.Errorf("svg: unrecognized Format %q", opts.Format)
+	}
 }
 
 func DecodeOptions(m map[string]interface{}) (opts Options, err error) {
@@ -46,7 +154,10 @@ func DecodeOptions(m map[string]interface{}) (opts Options, err error) {
 	return
 }
 
-func (opts Options) toArgs() []string {
+// toArgs builds the Inkscape CLI flags for these options. The flag names for
+// selecting an element and piping data in/out changed between Inkscape 0.9x
+// and 1.0, so the caller's detected major version picks the right dialect.
+func (opts Options) toArgs(inkscapeMajor int) []string {
 	var args []string
 	if opts.Width != 0 {
 		args = append(args, "-w", strconv.Itoa(opts.Width))
@@ -55,7 +166,11 @@ func (opts Options) toArgs() []string {
 		args = append(args, "-h", strconv.Itoa(opts.Height))
 	}
 	if opts.ElementID != "" {
-		args = append(args, "-i", opts.ElementID)
+		if inkscapeMajor >= 1 {
+			args = append(args, fmt.Sprintf("--export-id=%s", opts.ElementID))
+		} else {
+			args = append(args, "-i", opts.ElementID)
+		}
 	}
 	if opts.ExportArea != "" {
 		if opts.ExportArea == "page" {
@@ -69,6 +184,15 @@ func (opts Options) toArgs() []string {
 	if opts.ExportAreaSnap {
 		args = append(args, "--export-area-snap")
 	}
+	if opts.DPI != 0 {
+		args = append(args, fmt.Sprintf("--export-dpi=%v", opts.DPI))
+	}
+	if opts.Background != "" {
+		args = append(args, fmt.Sprintf("--export-background=%s", opts.Background))
+	}
+	if opts.BackgroundOpacity != 0 {
+		args = append(args, fmt.Sprintf("--export-background-opacity=%v", opts.BackgroundOpacity))
+	}
 	return args
 }
 
@@ -76,6 +200,12 @@ func (opts Options) toArgs() []string {
 type Client struct {
 	sfs *filesystems.SourceFilesystem
 	rs  *resources.Spec
+
+	inkscapeVersionOnce  sync.Once
+	inkscapeVersionMajor int
+
+	shellPoolOnce sync.Once
+	shellPool     *inkscapeShellPool
 }
 
 // New creates a new Client with the given specification.
@@ -83,6 +213,55 @@ func New(fs *filesystems.SourceFilesystem, rs *resources.Spec) *Client {
 	return &Client{sfs: fs, rs: rs}
 }
 
+// inkscapeMajorVersion detects and caches the installed Inkscape's major
+// version, so Transform can pick the right CLI dialect (0.9x vs 1.0+). 0 is
+// returned if the version could not be determined.
+func (c *Client) inkscapeMajorVersion() int {
+	c.inkscapeVersionOnce.Do(func() {
+		c.inkscapeVersionMajor = detectInkscapeMajorVersion()
+	})
+	return c.inkscapeVersionMajor
+}
+
+// shellPoolFor returns the Client's pool of `inkscape --shell` workers,
+// creating it on first use with the given size and per-worker job limit.
+// Later calls with a different size are ignored; the pool is sized once by
+// whichever Options.PoolSize reaches it first.
+func (c *Client) shellPoolFor(size, maxJobsPerWorker int) *inkscapeShellPool {
+	c.shellPoolOnce.Do(func() {
+		c.shellPool = newInkscapeShellPool(size, maxJobsPerWorker)
+	})
+	return c.shellPool
+}
+
+func detectInkscapeMajorVersion() int {
+	out, err := exec.Command("inkscape", "--version").Output()
+	if err != nil {
+		return 0
+	}
+	return parseInkscapeMajorVersion(string(out))
+}
+
+// parseInkscapeMajorVersion extracts the major version number from the
+// output of `inkscape --version`, e.g. "Inkscape 1.0.2 (...)" or
+// "Inkscape 0.92.4 (...)". Split out from detectInkscapeMajorVersion so the
+// parsing logic can be unit tested without an inkscape binary.
+func parseInkscapeMajorVersion(versionOutput string) int {
+	for _, field := range strings.Fields(versionOutput) {
+		if len(field) == 0 || field[0] < '0' || field[0] > '9' {
+			continue
+		}
+		major, _, ok := strings.Cut(field, ".")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.Atoi(major); err == nil {
+			return v
+		}
+	}
+	return 0
+}
+
 type svgTransformation struct {
 	c       *Client
 	rs      *resources.Spec
@@ -93,19 +272,46 @@ func (t *svgTransformation) Key() internal.ResourceTransformationKey {
 	return internal.NewResourceTransformationKey("svgToPng", t.options)
 }
 
-// Transform shells out to inkscape to do the heavy lifting.
-// For this to work, you need to have the inkscape binary installed.
+// Transform rasterizes the SVG, either by shelling out to Inkscape or by
+// using the pure-Go native backend, depending on Options.Backend.
 func (t *svgTransformation) Transform(ctx *resources.ResourceTransformationCtx) error {
-	const binaryName = "inkscape"
-
-	if _, err := exec.LookPath(binaryName); err != nil {
-		// This may be on a CI server etc. Will fall back to pre-built assets.
-		return herrors.ErrFeatureNotAvailable
+	outMediaType, _, err := t.options.outputMediaTypeAndExt()
+	if err != nil {
+		return err
 	}
 
 	ctx.InMediaType = media.SVGType
-	ctx.OutMediaType = media.PNGType
+	ctx.OutMediaType = outMediaType
 
+	t.setOutPath(ctx)
+
+	switch t.options.backend() {
+	case backendInkscape:
+		if !inkscapeAvailable() {
+			return herrors.ErrFeatureNotAvailable
+		}
+		return t.transformInkscape(ctx)
+	case backendNative:
+		return t.transformNative(ctx)
+	case backendAuto:
+		if inkscapeAvailable() {
+			return t.transformInkscape(ctx)
+		}
+		// This may be on a CI server etc. Fall back to the native backend.
+		return t.transformNative(ctx)
+	default:
+		return fmt.Errorf("svg: unrecognized Backend %q", t.options.Backend)
+	}
+}
+
+func inkscapeAvailable() bool {
+	_, err := exec.LookPath("inkscape")
+	return err == nil
+}
+
+// setOutPath computes ctx.OutPath/extension from the options, shared by all
+// backends.
+func (t *svgTransformation) setOutPath(ctx *resources.ResourceTransformationCtx) {
 	if t.options.TargetPath != "" {
 		ctx.OutPath = t.options.TargetPath
 	} else {
@@ -120,32 +326,83 @@ func (t *svgTransformation) Transform(ctx *resources.ResourceTransformationCtx)
 			prefix = "_snap"
 		}
 
+		_, suffix, _ := t.options.outputMediaTypeAndExt()
+
 		var ext string
 		if t.options.Width != 0 && t.options.Height != 0 {
-			ext = fmt.Sprintf("%s-%dx%d.png", prefix, t.options.Width, t.options.Height)
+			ext = fmt.Sprintf("%s-%dx%d.%s", prefix, t.options.Width, t.options.Height, suffix)
 		} else if t.options.Width != 0 {
-			ext = fmt.Sprintf("%s-%d.png", prefix, t.options.Width)
+			ext = fmt.Sprintf("%s-%dw.%s", prefix, t.options.Width, suffix)
 		} else if t.options.Height != 0 {
-			ext = fmt.Sprintf("%s-%d.png", prefix, t.options.Height)
+			ext = fmt.Sprintf("%s-%d.%s", prefix, t.options.Height, suffix)
 		} else {
-			ext = prefix + ".png"
+			ext = prefix + "." + suffix
 		}
 
 		ctx.ReplaceOutPathExtension(ext)
 	}
+}
+
+// transformInkscape shells out to inkscape to do the heavy lifting.
+// For this to work, you need to have the inkscape binary installed.
+func (t *svgTransformation) transformInkscape(ctx *resources.ResourceTransformationCtx) error {
+	const binaryName = "inkscape"
+
+	major := t.c.inkscapeMajorVersion()
+	format := t.options.format()
+
+	if t.options.PoolSize > 0 && major >= 1 {
+		// The pooled worker protocol below relies on the structured
+		// file-open/export-do commands only supported by Inkscape 1.x's
+		// --shell mode. Older Inkscape falls through to the plain per-call
+		// invocation.
+		return t.transformInkscapePooled(ctx)
+	}
 
 	var cmdArgs []string
-	if optArgs := t.options.toArgs(); len(optArgs) > 0 {
+	if optArgs := t.options.toArgs(major); len(optArgs) > 0 {
 		cmdArgs = append(cmdArgs, optArgs...)
 	}
 
-	cmdArgs = append(cmdArgs, "-f", "-")
-	cmdArgs = append(cmdArgs, "-e", "-")
+	if major >= 1 {
+		cmdArgs = append(cmdArgs, "--pipe")
+	} else {
+		cmdArgs = append(cmdArgs, "-f", "-")
+	}
+
+	switch format {
+	case "pdf":
+		if major >= 1 {
+			cmdArgs = append(cmdArgs, "--export-type=pdf", "--export-filename=-")
+		} else {
+			cmdArgs = append(cmdArgs, "-A", "-")
+		}
+	case "ps":
+		if major >= 1 {
+			cmdArgs = append(cmdArgs, "--export-type=ps", "--export-filename=-")
+		} else {
+			cmdArgs = append(cmdArgs, "-P", "-")
+		}
+	default:
+		// png, jpeg and webp are all rasterized by Inkscape as PNG; jpeg and
+		// webp are then re-encoded below.
+		if major >= 1 {
+			cmdArgs = append(cmdArgs, "--export-type=png", "--export-filename=-")
+		} else {
+			cmdArgs = append(cmdArgs, "-e", "-")
+		}
+	}
 
 	cmd := exec.Command(binaryName, cmdArgs...)
-	cmd.Stdout = ctx.To
 	//cmd.Stderr = os.Stderr
 
+	var pngBuf bytes.Buffer
+	if format == "jpeg" || format == "webp" {
+		cmd.Stdout = &pngBuf
+	} else {
+		cmd.Stdout = ctx.To
+	}
+
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return err
@@ -156,14 +413,68 @@ func (t *svgTransformation) Transform(ctx *resources.ResourceTransformationCtx)
 		io.Copy(stdin, ctx.From)
 	}()
 
-	err = cmd.Run()
-	if err != nil {
+	if err := cmd.Run(); err != nil {
 		return err
 	}
-	return nil
+
+	switch format {
+	case "jpeg":
+		return encodeJPEG(ctx.To, pngBuf.Bytes(), t.options.quality())
+	case "webp":
+		return encodeWebP(ctx.To, pngBuf.Bytes(), t.options.quality())
+	default:
+		return nil
+	}
+}
+
+// Process transforms the given Resource according to Options.Format (PNG by
+// default). If Options.Sizes is set, one variant is produced per requested
+// width and all of them are returned; otherwise the result is a
+// single-element resource.Resources.
+func (c *Client) Process(res resources.ResourceTransformer, options Options) (resource.Resources, error) {
+	if len(options.Sizes) == 0 {
+		r, err := res.Transform(&svgTransformation{c: c, rs: c.rs, options: options})
+		if err != nil {
+			return nil, err
+		}
+		return resource.Resources{r}, nil
+	}
+
+	if options.TargetPath != "" {
+		// Every variant would otherwise resolve to the same, explicit
+		// OutPath and clobber each other on write; setOutPath only varies
+		// the filename by width when TargetPath is unset.
+		return nil, fmt.Errorf("svg: TargetPath cannot be combined with Sizes, each size needs its own output path")
+	}
+
+	variants := make(resource.Resources, len(options.Sizes))
+	for i, size := range options.Sizes {
+		sizeOptions := options
+		sizeOptions.Sizes = nil
+		sizeOptions.Width = size
+		sizeOptions.Height = 0
+
+		r, err := res.Transform(&svgTransformation{c: c, rs: c.rs, options: sizeOptions})
+		if err != nil {
+			return nil, err
+		}
+		variants[i] = r
+	}
+	return variants, nil
 }
 
-// Process transforms the given Resource with the PostCSS processor.
-func (c *Client) Process(res resources.ResourceTransformer, options Options) (resource.Resource, error) {
-	return res.Transform(&svgTransformation{c: c, rs: c.rs, options: options})
+// Srcset formats resources, together with the pixel widths they were
+// rendered at, as an HTML srcset attribute value, e.g.
+// "/a-320w.png 320w, /a-640w.png 640w". widths must have the same length and
+// order as resources, e.g. the Options.Sizes passed to Process.
+func Srcset(resources resource.Resources, widths []int) (string, error) {
+	if len(resources) != len(widths) {
+		return "", fmt.Errorf("svg: Srcset needs one width per resource, got %d resources and %d widths", len(resources), len(widths))
+	}
+
+	parts := make([]string, len(resources))
+	for i, res := range resources {
+		parts[i] = fmt.Sprintf("%s %dw", res.RelPermalink(), widths[i])
+	}
+	return strings.Join(parts, ", "), nil
 }
@@ -0,0 +1,52 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svg
+
+import (
+	"bytes"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os/exec"
+	"strconv"
+
+	"github.com/gohugoio/hugo/common/herrors"
+)
+
+// encodeJPEG re-encodes a PNG image as JPEG.
+func encodeJPEG(w io.Writer, pngData []byte, quality int) error {
+	img, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+// encodeWebP re-encodes a PNG image as WebP by shelling out to cwebp, the
+// reference encoder from Google's libwebp -- the Go ecosystem has no
+// maintained pure-Go WebP encoder, so this mirrors the Inkscape-as-external-
+// tool approach used for rasterization.
+func encodeWebP(w io.Writer, pngData []byte, quality int) error {
+	const binaryName = "cwebp"
+
+	if _, err := exec.LookPath(binaryName); err != nil {
+		return herrors.ErrFeatureNotAvailable
+	}
+
+	cmd := exec.Command(binaryName, "-quiet", "-q", strconv.Itoa(quality), "-o", "-", "--", "-")
+	cmd.Stdin = bytes.NewReader(pngData)
+	cmd.Stdout = w
+
+	return cmd.Run()
+}
@@ -0,0 +1,273 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+
+	"github.com/gohugoio/hugo/common/herrors"
+	"github.com/gohugoio/hugo/resources"
+)
+
+// transformNative rasterizes the SVG using a pure-Go backend (oksvg +
+// rasterx), without relying on an external inkscape binary.
+func (t *svgTransformation) transformNative(ctx *resources.ResourceTransformationCtx) error {
+	format := t.options.format()
+	if format == "pdf" || format == "ps" {
+		// pdf and ps are vector formats; the native backend only
+		// rasterizes. Report this the same way as a missing inkscape
+		// binary, so sites on Backend "auto" still fall back to their
+		// pre-built assets instead of failing the build.
+		return herrors.ErrFeatureNotAvailable
+	}
+
+	in, err := io.ReadAll(ctx.From)
+	if err != nil {
+		return err
+	}
+
+	if t.options.ElementID != "" {
+		in, err = extractElementByID(in, t.options.ElementID)
+		if err != nil {
+			return err
+		}
+	}
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(in))
+	if err != nil {
+		return fmt.Errorf("svg: failed to parse SVG: %w", err)
+	}
+
+	x0, y0, x1, y1, err := t.exportArea(icon)
+	if err != nil {
+		return err
+	}
+
+	w, h := t.targetDimensions(x1-x0, y1-y0)
+
+	icon.ViewBox.X, icon.ViewBox.Y, icon.ViewBox.W, icon.ViewBox.H = x0, y0, x1-x0, y1-y0
+	icon.SetTarget(0, 0, float64(w), float64(h))
+
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	scanner := rasterx.NewScannerGV(w, h, rgba, rgba.Bounds())
+	raster := rasterx.NewDasher(w, h, scanner)
+	icon.Draw(raster, 1.0)
+
+	switch format {
+	case "jpeg":
+		var pngBuf bytes.Buffer
+		if err := png.Encode(&pngBuf, rgba); err != nil {
+			return err
+		}
+		return encodeJPEG(ctx.To, pngBuf.Bytes(), t.options.quality())
+	case "webp":
+		var pngBuf bytes.Buffer
+		if err := png.Encode(&pngBuf, rgba); err != nil {
+			return err
+		}
+		return encodeWebP(ctx.To, pngBuf.Bytes(), t.options.quality())
+	default: // "png"
+		return png.Encode(ctx.To, rgba)
+	}
+}
+
+// exportArea resolves the Options.ExportArea setting into the bounds (in SVG
+// user units) that should be rasterized. "page" (the default) uses the
+// document's viewBox, "drawing" uses the bounding box of the actual paths,
+// and anything else is parsed as an explicit "x0:y0:x1:y1" rectangle.
+func (t *svgTransformation) exportArea(icon *oksvg.SvgIcon) (x0, y0, x1, y1 float64, err error) {
+	switch t.options.ExportArea {
+	case "", "page":
+		return icon.ViewBox.X, icon.ViewBox.Y, icon.ViewBox.X + icon.ViewBox.W, icon.ViewBox.Y + icon.ViewBox.H, nil
+	case "drawing":
+		return pathsBounds(icon)
+	default:
+		parts := strings.Split(t.options.ExportArea, ":")
+		if len(parts) != 4 {
+			return 0, 0, 0, 0, fmt.Errorf("svg: invalid ExportArea %q, want \"drawing\", \"page\" or \"x0:y0:x1:y1\"", t.options.ExportArea)
+		}
+		vals := make([]float64, 4)
+		for i, p := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return 0, 0, 0, 0, fmt.Errorf("svg: invalid ExportArea %q: %w", t.options.ExportArea, err)
+			}
+			vals[i] = v
+		}
+		return vals[0], vals[1], vals[2], vals[3], nil
+	}
+}
+
+// targetDimensions computes the pixel size of the rasterized output,
+// honoring Width/Height and preserving the source aspect ratio when only one
+// of them is set.
+func (t *svgTransformation) targetDimensions(srcW, srcH float64) (w, h int) {
+	switch {
+	case t.options.Width != 0 && t.options.Height != 0:
+		return t.options.Width, t.options.Height
+	case t.options.Width != 0:
+		ratio := srcH / srcW
+		return t.options.Width, int(math.Round(float64(t.options.Width) * ratio))
+	case t.options.Height != 0:
+		ratio := srcW / srcH
+		return int(math.Round(float64(t.options.Height) * ratio)), t.options.Height
+	default:
+		return int(math.Round(srcW)), int(math.Round(srcH))
+	}
+}
+
+// pathsBounds computes the bounding box, in user units, of all paths in the
+// icon -- used for ExportArea "drawing".
+func pathsBounds(icon *oksvg.SvgIcon) (x0, y0, x1, y1 float64, err error) {
+	first := true
+	update := func(x, y float64) {
+		if first {
+			x0, x1, y0, y1 = x, x, y, y
+			first = false
+			return
+		}
+		if x < x0 {
+			x0 = x
+		}
+		if x > x1 {
+			x1 = x
+		}
+		if y < y0 {
+			y0 = y
+		}
+		if y > y1 {
+			y1 = y
+		}
+	}
+
+	for _, p := range icon.SVGPaths {
+		i := 0
+		path := p.Path
+		// rasterx paths store coordinates as fixed.Int26_6 (1/64 units).
+		pt := func(j int) (float64, float64) {
+			return float64(path[j]) / 64, float64(path[j+1]) / 64
+		}
+		for i < len(path) {
+			switch rasterx.PathCommand(path[i]) {
+			case rasterx.PathMoveTo, rasterx.PathLineTo:
+				update(pt(i + 1))
+				i += 3
+			case rasterx.PathQuadTo:
+				update(pt(i + 1))
+				update(pt(i + 3))
+				i += 5
+			case rasterx.PathCubicTo:
+				update(pt(i + 1))
+				update(pt(i + 3))
+				update(pt(i + 5))
+				i += 7
+			case rasterx.PathClose:
+				i++
+			default:
+				i++
+			}
+		}
+	}
+
+	if first {
+		return 0, 0, 0, 0, fmt.Errorf("svg: ExportArea \"drawing\" found no paths to measure")
+	}
+
+	return x0, y0, x1, y1, nil
+}
+
+// extractElementByID returns a standalone SVG document containing only the
+// subtree of the element (e.g. a <g>) with the given id, so that ElementID
+// works the same way on the native backend as it does for Inkscape's -i flag.
+func extractElementByID(data []byte, id string) ([]byte, error) {
+	var rootAttrs []xml.Attr
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var start int64 = -1
+	depth := 0
+	for {
+		off := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("svg: failed to parse SVG looking for ElementID %q: %w", id, err)
+		}
+
+		switch se := tok.(type) {
+		case xml.StartElement:
+			if rootAttrs == nil {
+				rootAttrs = se.Attr
+			}
+			if start < 0 && hasID(se.Attr, id) {
+				start = off
+			}
+			if start >= 0 {
+				depth++
+			}
+		case xml.EndElement:
+			if start >= 0 {
+				depth--
+				if depth == 0 {
+					end := dec.InputOffset()
+					return wrapFragment(data[start:end], rootAttrs), nil
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("svg: no element found with id %q", id)
+}
+
+func hasID(attrs []xml.Attr, id string) bool {
+	for _, a := range attrs {
+		if a.Name.Local == "id" && a.Value == id {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapFragment wraps an extracted element in a minimal <svg> root, copying
+// over the original document's sizing attributes (viewBox, width, height,
+// xmlns) so the fragment still rasterizes at the right scale.
+func wrapFragment(fragment []byte, rootAttrs []xml.Attr) []byte {
+	var b bytes.Buffer
+	b.WriteString("<svg")
+	for _, a := range rootAttrs {
+		switch a.Name.Local {
+		case "viewBox", "width", "height", "xmlns":
+			fmt.Fprintf(&b, ` %s="%s"`, a.Name.Local, a.Value)
+		}
+	}
+	if !bytes.Contains(b.Bytes(), []byte("xmlns=")) {
+		b.WriteString(` xmlns="http://www.w3.org/2000/svg"`)
+	}
+	b.WriteString(">")
+	b.Write(fragment)
+	b.WriteString("</svg>")
+	return b.Bytes()
+}
@@ -0,0 +1,195 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/srwiley/oksvg"
+
+	"github.com/gohugoio/hugo/common/herrors"
+	"github.com/gohugoio/hugo/resources"
+)
+
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100">
+  <g id="layer1"><rect x="0" y="0" width="10" height="10"/></g>
+  <g id="layer2"><rect x="20" y="20" width="10" height="10"/></g>
+</svg>`
+
+func TestExtractElementByID(t *testing.T) {
+	out, err := extractElementByID([]byte(testSVG), "layer1")
+	if err != nil {
+		t.Fatalf("extractElementByID() error = %v", err)
+	}
+	got := string(out)
+	if !strings.Contains(got, `id="layer1"`) {
+		t.Errorf("extractElementByID() result missing layer1: %s", got)
+	}
+	if strings.Contains(got, `id="layer2"`) {
+		t.Errorf("extractElementByID() result unexpectedly contains layer2: %s", got)
+	}
+	if !strings.Contains(got, `viewBox="0 0 100 100"`) {
+		t.Errorf("extractElementByID() result missing original viewBox: %s", got)
+	}
+}
+
+func TestExtractElementByIDNotFound(t *testing.T) {
+	if _, err := extractElementByID([]byte(testSVG), "nope"); err == nil {
+		t.Fatal("extractElementByID() with unknown id: want error, got nil")
+	}
+}
+
+func TestTargetDimensions(t *testing.T) {
+	tr := &svgTransformation{}
+
+	for _, test := range []struct {
+		name          string
+		width, height int
+		srcW, srcH    float64
+		wantW, wantH  int
+	}{
+		{"both set", 200, 100, 400, 400, 200, 100},
+		{"width only, preserves aspect", 200, 0, 400, 200, 200, 100},
+		{"height only, preserves aspect", 0, 100, 400, 200, 200, 100},
+		{"neither set, rounds source size", 0, 0, 400.4, 200.6, 400, 201},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tr.options = Options{Width: test.width, Height: test.height}
+			w, h := tr.targetDimensions(test.srcW, test.srcH)
+			if w != test.wantW || h != test.wantH {
+				t.Errorf("targetDimensions(%v, %v) = (%d, %d), want (%d, %d)", test.srcW, test.srcH, w, h, test.wantW, test.wantH)
+			}
+		})
+	}
+}
+
+func TestWrapFragment(t *testing.T) {
+	rootAttrs := []xml.Attr{
+		{Name: xml.Name{Local: "viewBox"}, Value: "0 0 100 100"},
+		{Name: xml.Name{Local: "width"}, Value: "100"},
+	}
+
+	out := wrapFragment([]byte("<rect/>"), rootAttrs)
+	got := string(out)
+
+	if !strings.Contains(got, `viewBox="0 0 100 100"`) {
+		t.Errorf("wrapFragment() missing viewBox: %s", got)
+	}
+	if !strings.Contains(got, `xmlns="http://www.w3.org/2000/svg"`) {
+		t.Errorf("wrapFragment() missing default xmlns: %s", got)
+	}
+	if !strings.Contains(got, "<rect/>") {
+		t.Errorf("wrapFragment() missing original fragment: %s", got)
+	}
+}
+
+const exportAreaTestSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 50"><rect x="10" y="10" width="20" height="20"/></svg>`
+
+func TestExportArea(t *testing.T) {
+	icon, err := oksvg.ReadIconStream(strings.NewReader(exportAreaTestSVG))
+	if err != nil {
+		t.Fatalf("oksvg.ReadIconStream() error = %v", err)
+	}
+
+	for _, test := range []struct {
+		name                           string
+		area                           string
+		wantX0, wantY0, wantX1, wantY1 float64
+	}{
+		{"page (default)", "", 0, 0, 100, 50},
+		{"page (explicit)", "page", 0, 0, 100, 50},
+		{"drawing", "drawing", 10, 10, 30, 30},
+		{"explicit rect", "1:2:3:4", 1, 2, 3, 4},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tr := &svgTransformation{options: Options{ExportArea: test.area}}
+			x0, y0, x1, y1, err := tr.exportArea(icon)
+			if err != nil {
+				t.Fatalf("exportArea() error = %v", err)
+			}
+			if x0 != test.wantX0 || y0 != test.wantY0 || x1 != test.wantX1 || y1 != test.wantY1 {
+				t.Errorf("exportArea() = (%v, %v, %v, %v), want (%v, %v, %v, %v)", x0, y0, x1, y1, test.wantX0, test.wantY0, test.wantX1, test.wantY1)
+			}
+		})
+	}
+
+	t.Run("invalid rect", func(t *testing.T) {
+		tr := &svgTransformation{options: Options{ExportArea: "not-a-rect"}}
+		if _, _, _, _, err := tr.exportArea(icon); err == nil {
+			t.Fatal("exportArea() with invalid ExportArea: want error, got nil")
+		}
+	})
+}
+
+func TestExportAreaDrawingNoPaths(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"></svg>`
+	icon, err := oksvg.ReadIconStream(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("oksvg.ReadIconStream() error = %v", err)
+	}
+
+	tr := &svgTransformation{options: Options{ExportArea: "drawing"}}
+	if _, _, _, _, err := tr.exportArea(icon); err == nil {
+		t.Fatal(`exportArea("drawing") with no paths: want error, got nil`)
+	}
+}
+
+func TestTransformNativeRasterizesSVG(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10" width="10" height="10"><rect width="10" height="10" fill="#ff0000"/></svg>`
+
+	tr := &svgTransformation{options: Options{}}
+	var buf bytes.Buffer
+	ctx := &resources.ResourceTransformationCtx{
+		From: strings.NewReader(src),
+		To:   &buf,
+	}
+
+	if err := tr.transformNative(ctx); err != nil {
+		t.Fatalf("transformNative() error = %v", err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("transformNative() did not produce a valid PNG: %v", err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() != 10 || bounds.Dy() != 10 {
+		t.Errorf("transformNative() image size = %dx%d, want 10x10", bounds.Dx(), bounds.Dy())
+	}
+
+	r, g, b, _ := img.At(5, 5).RGBA()
+	if r>>8 != 0xff || g>>8 != 0 || b>>8 != 0 {
+		t.Errorf("transformNative() center pixel = (%d, %d, %d), want red", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestTransformNativeRejectsVectorFormats(t *testing.T) {
+	for _, format := range []string{"pdf", "ps"} {
+		t.Run(format, func(t *testing.T) {
+			tr := &svgTransformation{options: Options{Format: format}}
+			ctx := &resources.ResourceTransformationCtx{
+				From: strings.NewReader(exportAreaTestSVG),
+				To:   &bytes.Buffer{},
+			}
+			if err := tr.transformNative(ctx); err != herrors.ErrFeatureNotAvailable {
+				t.Errorf("transformNative() with Format %q: error = %v, want %v", format, err, herrors.ErrFeatureNotAvailable)
+			}
+		})
+	}
+}
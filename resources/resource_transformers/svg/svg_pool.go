@@ -0,0 +1,304 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gohugoio/hugo/resources"
+)
+
+// inkscapeShellPool is a bounded pool of long-lived `inkscape --shell`
+// worker processes, used to amortize Inkscape's startup cost across many
+// Transform calls. Workers are created lazily, up to size, and recycled
+// after maxJobsPerWorker jobs to bound their memory growth.
+type inkscapeShellPool struct {
+	maxJobsPerWorker int
+	newWorker        func() (*inkscapeShellWorker, error)
+	// tokens has capacity size. A nil token means "not started yet"; a
+	// non-nil token is a ready worker. Acquiring blocks until a token (of
+	// either kind) is available, which is what bounds the pool size.
+	tokens chan *inkscapeShellWorker
+}
+
+func newInkscapeShellPool(size, maxJobsPerWorker int) *inkscapeShellPool {
+	return newInkscapeShellPoolWithFactory(size, maxJobsPerWorker, startInkscapeShellWorker)
+}
+
+// newInkscapeShellPoolWithFactory is newInkscapeShellPool with an injectable
+// worker factory, so the pool's bookkeeping can be unit tested without
+// spawning real inkscape processes.
+func newInkscapeShellPoolWithFactory(size, maxJobsPerWorker int, newWorker func() (*inkscapeShellWorker, error)) *inkscapeShellPool {
+	if size <= 0 {
+		size = 1
+	}
+	p := &inkscapeShellPool{
+		maxJobsPerWorker: maxJobsPerWorker,
+		newWorker:        newWorker,
+		tokens:           make(chan *inkscapeShellWorker, size),
+	}
+	for i := 0; i < size; i++ {
+		p.tokens <- nil
+	}
+	return p
+}
+
+func (p *inkscapeShellPool) acquire() (*inkscapeShellWorker, error) {
+	w := <-p.tokens
+	if w != nil {
+		return w, nil
+	}
+	w, err := p.newWorker()
+	if err != nil {
+		// The spawn failed, so no worker was created to consume this slot.
+		// Requeue it as a retry slot, otherwise every failed spawn
+		// permanently shrinks the pool until acquire blocks forever.
+		p.tokens <- nil
+		return nil, err
+	}
+	return w, nil
+}
+
+// release returns w to the pool, recycling it first if it has handled its
+// quota of jobs. ok must be false if w's last job failed (runJob returned an
+// error): such a worker's process may be wedged or dead, so it's closed and
+// discarded -- like acquire() does for a failed spawn -- rather than being
+// requeued as healthy, which would otherwise wedge that pool slot into
+// always failing for the life of the process.
+func (p *inkscapeShellPool) release(w *inkscapeShellWorker, ok bool) {
+	if !ok {
+		w.close()
+		p.tokens <- nil
+		return
+	}
+	w.jobs++
+	if p.maxJobsPerWorker > 0 && w.jobs >= p.maxJobsPerWorker {
+		w.close()
+		p.tokens <- nil
+		return
+	}
+	p.tokens <- w
+}
+
+// inkscapeShellWorker is one `inkscape --shell` process.
+type inkscapeShellWorker struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	jobs  int
+}
+
+func startInkscapeShellWorker() (*inkscapeShellWorker, error) {
+	cmd := exec.Command("inkscape", "--shell")
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// --shell mode has no documented, stable stdout protocol to parse, so
+	// its output is discarded; job completion is detected by polling for
+	// a separate marker file instead, see runJob.
+	cmd.Stdout = io.Discard
+	cmd.Stderr = io.Discard
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &inkscapeShellWorker{cmd: cmd, stdin: stdin}, nil
+}
+
+func (w *inkscapeShellWorker) close() {
+	w.stdin.Close()
+	w.cmd.Wait()
+}
+
+const shellJobTimeout = 30 * time.Second
+
+// markerSourceSVG is a fixed, trivial 1x1 document exported as the
+// completion marker, see toShellCommands and runJob.
+const markerSourceSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="1" height="1"><rect width="1" height="1"/></svg>`
+
+// runJob sends commands (a semicolon-separated Inkscape shell command
+// sequence, see toShellCommands) to the worker and waits for markerFile to
+// appear.
+//
+// --shell mode has no documented, stable stdout protocol to signal "done",
+// so completion is detected differently: toShellCommands appends a second,
+// tiny export writing to markerFile *after* the real export in the same
+// command line. Inkscape executes a command line's actions in order on a
+// single thread, so markerFile can only appear once the real export has
+// already been written in full -- unlike polling the real (and potentially
+// large, slowly-written) output file directly, this can't observe a
+// truncated partial write.
+//
+// The marker export opens its own tiny, fixed-size document rather than
+// reusing inFile: --shell mode doesn't guarantee export-width/export-height
+// reset on the next file-open within a long-lived session, so exporting the
+// marker against the real document would risk its 1x1 size leaking into a
+// later job on the same recycled worker that wants the SVG's native size.
+func (w *inkscapeShellWorker) runJob(commands, markerFile string) error {
+	if _, err := fmt.Fprintln(w.stdin, commands); err != nil {
+		return fmt.Errorf("svg: failed to send command to inkscape shell worker: %w", err)
+	}
+
+	deadline := time.Now().Add(shellJobTimeout)
+	for {
+		if fi, err := os.Stat(markerFile); err == nil && fi.Size() > 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("svg: timed out waiting for inkscape shell worker to finish %s", markerFile)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// toShellCommands builds the `inkscape --shell` command sequence equivalent
+// to toArgs, operating on files rather than stdin/stdout. It exports the
+// real output to stagingFile, followed by a throwaway PNG of markerSrcFile
+// (a separate, fixed 1x1 document, see runJob) to markerFile, so the caller
+// can use markerFile's appearance as a completion signal for stagingFile.
+func (opts Options) toShellCommands(inFile, stagingFile, markerSrcFile, markerFile string) string {
+	cmds := []string{fmt.Sprintf("file-open:%s", inFile)}
+
+	if opts.Width != 0 {
+		cmds = append(cmds, fmt.Sprintf("export-width:%d", opts.Width))
+	}
+	if opts.Height != 0 {
+		cmds = append(cmds, fmt.Sprintf("export-height:%d", opts.Height))
+	}
+	if opts.ElementID != "" {
+		cmds = append(cmds, fmt.Sprintf("export-id:%s", opts.ElementID))
+	}
+	switch opts.ExportArea {
+	case "":
+	case "page":
+		cmds = append(cmds, "export-area-page")
+	case "drawing":
+		cmds = append(cmds, "export-area-drawing")
+	default:
+		cmds = append(cmds, fmt.Sprintf("export-area:%s", opts.ExportArea))
+	}
+	if opts.ExportAreaSnap {
+		cmds = append(cmds, "export-area-snap")
+	}
+	if opts.DPI != 0 {
+		cmds = append(cmds, fmt.Sprintf("export-dpi:%v", opts.DPI))
+	}
+	if opts.Background != "" {
+		cmds = append(cmds, fmt.Sprintf("export-background:%s", opts.Background))
+	}
+	if opts.BackgroundOpacity != 0 {
+		cmds = append(cmds, fmt.Sprintf("export-background-opacity:%v", opts.BackgroundOpacity))
+	}
+
+	exportType := opts.format()
+	if exportType == "jpeg" || exportType == "webp" {
+		// Rasterized as PNG by Inkscape, then re-encoded by the caller.
+		exportType = "png"
+	}
+	cmds = append(cmds, fmt.Sprintf("export-type:%s", exportType))
+	cmds = append(cmds, fmt.Sprintf("export-filename:%s", stagingFile))
+	cmds = append(cmds, "export-do")
+
+	// The marker: a separate, fixed-size 1x1 document, exported strictly
+	// after the real output above. Using its own file-open (rather than
+	// reusing inFile) keeps its size from ever becoming this session's
+	// export-width/export-height state for a later job, see runJob.
+	cmds = append(cmds, fmt.Sprintf("file-open:%s", markerSrcFile), "export-type:png",
+		fmt.Sprintf("export-filename:%s", markerFile), "export-do")
+
+	return strings.Join(cmds, ";")
+}
+
+// transformInkscapePooled renders through a pooled `inkscape --shell`
+// worker instead of spawning a new inkscape process for this Transform
+// call.
+func (t *svgTransformation) transformInkscapePooled(ctx *resources.ResourceTransformationCtx) error {
+	pool := t.c.shellPoolFor(t.options.PoolSize, t.options.poolMaxJobsPerWorker())
+
+	worker, err := pool.acquire()
+	if err != nil {
+		return err
+	}
+	ok := false
+	defer func() { pool.release(worker, ok) }()
+
+	inFile, err := os.CreateTemp("", "hugo-svg-in-*.svg")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(inFile.Name())
+
+	if _, err := io.Copy(inFile, ctx.From); err != nil {
+		inFile.Close()
+		return err
+	}
+	if err := inFile.Close(); err != nil {
+		return err
+	}
+
+	markerSrcFile, err := os.CreateTemp("", "hugo-svg-marker-*.svg")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(markerSrcFile.Name())
+	if _, err := markerSrcFile.WriteString(markerSourceSVG); err != nil {
+		markerSrcFile.Close()
+		return err
+	}
+	if err := markerSrcFile.Close(); err != nil {
+		return err
+	}
+
+	_, suffix, _ := t.options.outputMediaTypeAndExt()
+	outFile := inFile.Name() + "." + suffix
+	stagingFile := outFile + ".staging"
+	markerFile := outFile + ".marker"
+	defer os.Remove(outFile)
+	defer os.Remove(stagingFile)
+	defer os.Remove(markerFile)
+
+	commands := t.options.toShellCommands(inFile.Name(), stagingFile, markerSrcFile.Name(), markerFile)
+	if err := worker.runJob(commands, markerFile); err != nil {
+		return err
+	}
+	ok = true
+
+	// markerFile only appears once stagingFile has been written in full, see
+	// runJob; rename it into place now that it's safe to read.
+	if err := os.Rename(stagingFile, outFile); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		return err
+	}
+
+	switch t.options.format() {
+	case "jpeg":
+		return encodeJPEG(ctx.To, data, t.options.quality())
+	case "webp":
+		return encodeWebP(ctx.To, data, t.options.quality())
+	default:
+		_, err := ctx.To.Write(data)
+		return err
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svg
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// fakeWriteCloser is a no-op io.WriteCloser, so tests can build
+// inkscapeShellWorker values without spawning a real inkscape process.
+type fakeWriteCloser struct{}
+
+func (fakeWriteCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (fakeWriteCloser) Close() error                { return nil }
+
+// newFakeWorker builds an inkscapeShellWorker without spawning inkscape.
+// cmd is a real (but never-started) *exec.Cmd, so close()'s cmd.Wait() call
+// returns its "not started" error instead of panicking on a nil receiver.
+func newFakeWorker() *inkscapeShellWorker {
+	return &inkscapeShellWorker{cmd: exec.Command("true"), stdin: fakeWriteCloser{}}
+}
+
+func TestPoolAcquireRequeuesTokenOnSpawnFailure(t *testing.T) {
+	spawnErr := errors.New("spawn failed")
+	calls := 0
+	newWorker := func() (*inkscapeShellWorker, error) {
+		calls++
+		if calls == 1 {
+			return nil, spawnErr
+		}
+		return newFakeWorker(), nil
+	}
+
+	pool := newInkscapeShellPoolWithFactory(1, 0, newWorker)
+
+	if _, err := pool.acquire(); !errors.Is(err, spawnErr) {
+		t.Fatalf("acquire() error = %v, want %v", err, spawnErr)
+	}
+
+	// A second acquire must still find a retry slot, not block forever.
+	w, err := pool.acquire()
+	if err != nil {
+		t.Fatalf("acquire() after failed spawn: unexpected error %v", err)
+	}
+	if w == nil {
+		t.Fatal("acquire() after failed spawn: got nil worker")
+	}
+	if calls != 2 {
+		t.Errorf("newWorker called %d times, want 2", calls)
+	}
+}
+
+func TestPoolReleaseRecyclesAfterMaxJobs(t *testing.T) {
+	pool := newInkscapeShellPoolWithFactory(1, 2, func() (*inkscapeShellWorker, error) {
+		return newFakeWorker(), nil
+	})
+
+	w, err := pool.acquire()
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	pool.release(w, true)
+
+	w2, err := pool.acquire()
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	if w2 != w {
+		t.Fatalf("acquire() after one job: got a different worker, want the same recycled one")
+	}
+	pool.release(w2, true)
+
+	// w2 has now handled 2 jobs (maxJobsPerWorker), so it should have been
+	// closed and replaced with a fresh spawn slot.
+	w3, err := pool.acquire()
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	if w3 == w2 {
+		t.Errorf("acquire() after maxJobsPerWorker reached: got the same worker, want a freshly spawned one")
+	}
+}
+
+func TestPoolReleaseDiscardsFailedWorker(t *testing.T) {
+	calls := 0
+	pool := newInkscapeShellPoolWithFactory(1, 0, func() (*inkscapeShellWorker, error) {
+		calls++
+		return newFakeWorker(), nil
+	})
+
+	w, err := pool.acquire()
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	// Simulate the worker's job failing (e.g. runJob timed out because the
+	// process died): it must not be requeued as healthy.
+	pool.release(w, false)
+
+	w2, err := pool.acquire()
+	if err != nil {
+		t.Fatalf("acquire() after a failed job: unexpected error %v", err)
+	}
+	if w2 == w {
+		t.Errorf("acquire() after a failed job: got the same worker back, want a freshly spawned one")
+	}
+	if calls != 2 {
+		t.Errorf("newWorker called %d times, want 2", calls)
+	}
+}
+
+func TestToShellCommands(t *testing.T) {
+	opts := Options{Width: 100, Height: 50, ElementID: "layer1", Format: "jpeg"}
+
+	got := opts.toShellCommands("in.svg", "staging.png", "marker.svg", "marker.png")
+	cmds := strings.Split(got, ";")
+
+	wantContains := []string{
+		"file-open:in.svg",
+		"export-width:100",
+		"export-height:50",
+		"export-id:layer1",
+		"export-type:png", // jpeg is rasterized as png, then re-encoded
+		"export-filename:staging.png",
+		"file-open:marker.svg",
+		"export-filename:marker.png",
+	}
+	for _, want := range wantContains {
+		found := false
+		for _, c := range cmds {
+			if c == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("toShellCommands() = %q, missing expected command %q", got, want)
+		}
+	}
+
+	if cmds[len(cmds)-1] != "export-do" {
+		t.Errorf("toShellCommands() = %q, want to end with the marker's export-do", got)
+	}
+}
+
+var _ io.WriteCloser = fakeWriteCloser{}
@@ -0,0 +1,119 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svg
+
+import "testing"
+
+func TestParseInkscapeMajorVersion(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"inkscape 1.x", "Inkscape 1.0.2 (e86c870879, 2021-01-15)", 1},
+		{"inkscape 0.9x", "Inkscape 0.92.4 (5da689c313, 2019-01-14)", 0},
+		{"unparseable", "not a version string", 0},
+		{"empty", "", 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseInkscapeMajorVersion(test.in); got != test.want {
+				t.Errorf("parseInkscapeMajorVersion(%q) = %d, want %d", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+func TestOptionsDefaults(t *testing.T) {
+	var opts Options
+
+	if got := opts.backend(); got != backendAuto {
+		t.Errorf("backend() = %q, want %q", got, backendAuto)
+	}
+	if got := opts.format(); got != "png" {
+		t.Errorf("format() = %q, want %q", got, "png")
+	}
+	if got := opts.quality(); got != defaultQuality {
+		t.Errorf("quality() = %d, want %d", got, defaultQuality)
+	}
+	if got := opts.poolMaxJobsPerWorker(); got != defaultPoolMaxJobsPerWorker {
+		t.Errorf("poolMaxJobsPerWorker() = %d, want %d", got, defaultPoolMaxJobsPerWorker)
+	}
+}
+
+func TestOptionsOutputMediaTypeAndExt(t *testing.T) {
+	for _, test := range []struct {
+		format  string
+		wantExt string
+		wantErr bool
+	}{
+		{"", "png", false},
+		{"png", "png", false},
+		{"jpeg", "jpg", false},
+		{"webp", "webp", false},
+		{"pdf", "pdf", false},
+		{"ps", "ps", false},
+		{"bogus", "", true},
+	} {
+		t.Run(test.format, func(t *testing.T) {
+			opts := Options{Format: test.format}
+			_, ext, err := opts.outputMediaTypeAndExt()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("outputMediaTypeAndExt() for Format %q: want error, got nil", test.format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("outputMediaTypeAndExt() for Format %q: %v", test.format, err)
+			}
+			if ext != test.wantExt {
+				t.Errorf("outputMediaTypeAndExt() ext = %q, want %q", ext, test.wantExt)
+			}
+		})
+	}
+}
+
+func TestOptionsToArgs(t *testing.T) {
+	opts := Options{Width: 100, ElementID: "layer1"}
+
+	if got := opts.toArgs(1); !containsAll(got, "-w", "100", "--export-id=layer1") {
+		t.Errorf("toArgs(1) = %v, missing expected 1.x-dialect flags", got)
+	}
+
+	got := opts.toArgs(0)
+	if !containsAll(got, "-w", "100", "-i", "layer1") {
+		t.Errorf("toArgs(0) = %v, missing expected 0.9x-dialect flags", got)
+	}
+	for _, flag := range got {
+		if flag == "--export-id=layer1" {
+			t.Errorf("toArgs(0) = %v, unexpectedly used 1.x --export-id flag", got)
+		}
+	}
+}
+
+func containsAll(haystack []string, needles ...string) bool {
+	for _, n := range needles {
+		found := false
+		for _, h := range haystack {
+			if h == n {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}